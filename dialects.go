@@ -0,0 +1,224 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// Dialect knows how to recognize and decode one manufacturer/firmware's SRT
+// telemetry data line. parseSRT autodetects the dialect from the first data
+// line in a file that a known dialect recognizes and sticks with it for the
+// rest of that file, since a single SRT never mixes formats.
+type Dialect interface {
+	// Name identifies the dialect in error messages.
+	Name() string
+	// Matches reports whether line looks like this dialect's data line.
+	Matches(line string) bool
+	// Parse decodes a data line already confirmed to Match. The returned
+	// sample carries the fields that dialect's line holds; ID/Start/End are
+	// never set, and Bearing only by dialects that report a heading.
+	Parse(line string) (*MetrologySample, error)
+}
+
+// SRTParseError identifies a single data line a dialect failed to decode,
+// so callers can report exactly which lines were dropped instead of the
+// line silently vanishing from the output the way a swallowed
+// strconv.ParseFloat error used to.
+type SRTParseError struct {
+	Line    int
+	Dialect string
+	Text    string
+}
+
+func (e *SRTParseError) Error() string {
+	return fmt.Sprintf("srt: %s dialect failed to parse line %d: %q", e.Dialect, e.Line, e.Text)
+}
+
+// knownDialects is tried in order during autodetection; the first one whose
+// Matches reports true for the first data line in the file wins.
+var knownDialects = []Dialect{
+	djiHTMLDialect{},
+	djiMini2Dialect{},
+	djiLegacyDialect{},
+	autelEVODialect{},
+	parrotAnafiDialect{},
+}
+
+// detectDialect returns the first known dialect that recognizes line, or
+// nil if none of them do.
+func detectDialect(line string) Dialect {
+	for _, d := range knownDialects {
+		if d.Matches(line) {
+			return d
+		}
+	}
+	return nil
+}
+
+// ---- DJI Mini2, the layout this tool was originally written against ----
+// ex: F/2.8, SS 141.87, ISO 110, EV -0.7, DZOOM 1.000, GPS (-69.9191, 46.8451, 19), D 31.42m, H 11.80m, H.S 1.00m/s, V.S 0.70m/s
+
+type djiMini2Dialect struct{}
+
+var djiMini2Re = regexp.MustCompile(`F/([0-9.]*), SS ([0-9.]*), ISO ([0-9.]*), EV ([0-9.-]*), DZOOM ([0-9.]*), GPS \(([0-9.-]*), ([0-9.-]*), ([0-9.-]*)\), D ([0-9.-]*)m, H ([0-9.-]*)m, H\.S ([0-9.-]*)m/s. V\.S ([0-9.-]*)m/s`)
+
+func (djiMini2Dialect) Name() string { return "DJI-Mini2" }
+
+func (djiMini2Dialect) Matches(line string) bool { return djiMini2Re.MatchString(line) }
+
+func (d djiMini2Dialect) Parse(line string) (*MetrologySample, error) {
+	m := djiMini2Re.FindStringSubmatch(line)
+	if len(m) < 13 {
+		return nil, &SRTParseError{Dialect: d.Name(), Text: line}
+	}
+
+	s := &MetrologySample{}
+	s.FStop, _ = strconv.ParseFloat(m[1], 64)
+	s.Shutter, _ = strconv.ParseFloat(m[2], 64)
+	s.ISO, _ = strconv.Atoi(m[3])
+	s.EV, _ = strconv.ParseFloat(m[4], 64)
+	s.Zoom, _ = strconv.Atoi(m[5])
+	s.Longitude, _ = strconv.ParseFloat(m[6], 64)
+	s.Latitude, _ = strconv.ParseFloat(m[7], 64)
+	s.Sources, _ = strconv.Atoi(m[8])
+	s.DTH, _ = strconv.ParseFloat(m[9], 64)
+	s.Altitude, _ = strconv.ParseFloat(m[10], 64)
+	s.HorizontalSpeed, _ = strconv.ParseFloat(m[11], 64)
+	s.VerticalSpeed, _ = strconv.ParseFloat(m[12], 64)
+
+	return s, nil
+}
+
+// ---- DJI-HTML, newer firmware that wraps key/value pairs in <font> tags ----
+// ex: <font size="28">FrameCnt: 1, DiffTime: 33ms
+// [iso: 100] [shutter: 1/240] [fnum: 280] [ev: 0] [latitude: 46.8451] [longitude: -69.9191] [rel_alt: 11.80 abs_alt: 31.42]</font>
+
+type djiHTMLDialect struct{}
+
+var djiHTMLRe = regexp.MustCompile(`\[iso\s*:\s*([0-9]+)\]\s*\[shutter\s*:\s*([0-9]+)/([0-9.]+)\]\s*\[fnum\s*:\s*([0-9.]+)\]\s*\[ev\s*:\s*([0-9.-]+)\].*\[latitude\s*:\s*([0-9.-]+)\]\s*\[longitude\s*:\s*([0-9.-]+)\]\s*\[rel_alt\s*:\s*([0-9.-]+)\s*abs_alt\s*:\s*([0-9.-]+)\]`)
+
+func (djiHTMLDialect) Name() string { return "DJI-HTML" }
+
+// Matches only requires the bracketed telemetry fields, not the opening
+// <font> tag: real DJI-HTML SRT puts "<font ...>FrameCnt..." on its own
+// line and the "[iso: ...] ... [rel_alt: ... abs_alt: ...]" fields on the
+// next, so a line-by-line scanner never sees both on the same line.
+func (djiHTMLDialect) Matches(line string) bool {
+	return djiHTMLRe.MatchString(line)
+}
+
+func (d djiHTMLDialect) Parse(line string) (*MetrologySample, error) {
+	m := djiHTMLRe.FindStringSubmatch(line)
+	if len(m) < 10 {
+		return nil, &SRTParseError{Dialect: d.Name(), Text: line}
+	}
+
+	s := &MetrologySample{}
+	s.ISO, _ = strconv.Atoi(m[1])
+	shutterDenom, _ := strconv.ParseFloat(m[3], 64)
+	s.Shutter = shutterDenom
+	fnum, _ := strconv.ParseFloat(m[4], 64)
+	s.FStop = fnum / 100
+	s.EV, _ = strconv.ParseFloat(m[5], 64)
+	s.Latitude, _ = strconv.ParseFloat(m[6], 64)
+	s.Longitude, _ = strconv.ParseFloat(m[7], 64)
+	// rel_alt is height above the home point; abs_alt is height above sea
+	// level, not a horizontal distance to home, so DTH is left unset - this
+	// dialect doesn't carry that field.
+	s.Altitude, _ = strconv.ParseFloat(m[8], 64)
+
+	return s, nil
+}
+
+// ---- DJI-legacy, Spark/Phantom-era firmware ----
+// ex: GPS(-69.9191, 46.8451, 19.0m) BAROMETER:31.4m ISO:110 Shutter:1/141.87 EV:-0.7 Fnum:2.8
+
+type djiLegacyDialect struct{}
+
+var djiLegacyRe = regexp.MustCompile(`GPS\(([0-9.-]*), ([0-9.-]*), ([0-9.-]*)m\) BAROMETER:([0-9.-]*)m ISO:([0-9]*) Shutter:1/([0-9.]*) EV:([0-9.-]*) Fnum:([0-9.]*)`)
+
+func (djiLegacyDialect) Name() string { return "DJI-legacy" }
+
+func (djiLegacyDialect) Matches(line string) bool { return djiLegacyRe.MatchString(line) }
+
+func (d djiLegacyDialect) Parse(line string) (*MetrologySample, error) {
+	m := djiLegacyRe.FindStringSubmatch(line)
+	if len(m) < 9 {
+		return nil, &SRTParseError{Dialect: d.Name(), Text: line}
+	}
+
+	s := &MetrologySample{}
+	s.Longitude, _ = strconv.ParseFloat(m[1], 64)
+	s.Latitude, _ = strconv.ParseFloat(m[2], 64)
+	s.DTH, _ = strconv.ParseFloat(m[3], 64)
+	s.Altitude, _ = strconv.ParseFloat(m[4], 64)
+	s.ISO, _ = strconv.Atoi(m[5])
+	s.Shutter, _ = strconv.ParseFloat(m[6], 64)
+	s.EV, _ = strconv.ParseFloat(m[7], 64)
+	s.FStop, _ = strconv.ParseFloat(m[8], 64)
+
+	return s, nil
+}
+
+// ---- Autel EVO ----
+// ex: LAT:46.8451 LON:-69.9191 ALT:31.42m SPD:1.00m/s HEADING:182.3 ISO:110 SHUTTER:1/240 FNUM:2.8 EV:0
+
+type autelEVODialect struct{}
+
+var autelEVORe = regexp.MustCompile(`LAT:([0-9.-]*) LON:([0-9.-]*) ALT:([0-9.-]*)m SPD:([0-9.-]*)m/s HEADING:([0-9.-]*) ISO:([0-9]*) SHUTTER:1/([0-9.]*) FNUM:([0-9.]*) EV:([0-9.-]*)`)
+
+func (autelEVODialect) Name() string { return "Autel-EVO" }
+
+func (autelEVODialect) Matches(line string) bool { return autelEVORe.MatchString(line) }
+
+func (d autelEVODialect) Parse(line string) (*MetrologySample, error) {
+	m := autelEVORe.FindStringSubmatch(line)
+	if len(m) < 10 {
+		return nil, &SRTParseError{Dialect: d.Name(), Text: line}
+	}
+
+	s := &MetrologySample{}
+	s.Latitude, _ = strconv.ParseFloat(m[1], 64)
+	s.Longitude, _ = strconv.ParseFloat(m[2], 64)
+	s.Altitude, _ = strconv.ParseFloat(m[3], 64)
+	s.HorizontalSpeed, _ = strconv.ParseFloat(m[4], 64)
+	s.Bearing, _ = strconv.ParseFloat(m[5], 64)
+	s.ISO, _ = strconv.Atoi(m[6])
+	s.Shutter, _ = strconv.ParseFloat(m[7], 64)
+	s.FStop, _ = strconv.ParseFloat(m[8], 64)
+	s.EV, _ = strconv.ParseFloat(m[9], 64)
+
+	return s, nil
+}
+
+// ---- Parrot ANAFI ----
+// ex: latitude: 46.8451 longitude: -69.9191 altitude: 31.42 speed_vz: 0.70 yaw: 182.3 iso: 110 shutter_speed: 1/240 aperture: 2.8 ev: 0
+
+type parrotAnafiDialect struct{}
+
+var parrotAnafiRe = regexp.MustCompile(`latitude: ([0-9.-]*) longitude: ([0-9.-]*) altitude: ([0-9.-]*) speed_vz: ([0-9.-]*) yaw: ([0-9.-]*) iso: ([0-9]*) shutter_speed: 1/([0-9.]*) aperture: ([0-9.]*) ev: ([0-9.-]*)`)
+
+func (parrotAnafiDialect) Name() string { return "Parrot-ANAFI" }
+
+func (parrotAnafiDialect) Matches(line string) bool { return parrotAnafiRe.MatchString(line) }
+
+func (d parrotAnafiDialect) Parse(line string) (*MetrologySample, error) {
+	m := parrotAnafiRe.FindStringSubmatch(line)
+	if len(m) < 10 {
+		return nil, &SRTParseError{Dialect: d.Name(), Text: line}
+	}
+
+	s := &MetrologySample{}
+	s.Latitude, _ = strconv.ParseFloat(m[1], 64)
+	s.Longitude, _ = strconv.ParseFloat(m[2], 64)
+	s.Altitude, _ = strconv.ParseFloat(m[3], 64)
+	s.VerticalSpeed, _ = strconv.ParseFloat(m[4], 64)
+	s.Bearing, _ = strconv.ParseFloat(m[5], 64)
+	s.ISO, _ = strconv.Atoi(m[6])
+	s.Shutter, _ = strconv.ParseFloat(m[7], 64)
+	s.FStop, _ = strconv.ParseFloat(m[8], 64)
+	s.EV, _ = strconv.ParseFloat(m[9], 64)
+
+	return s, nil
+}
@@ -0,0 +1,123 @@
+package main
+
+import "testing"
+
+func TestDialectRoundTrips(t *testing.T) {
+	cases := []struct {
+		dialect  Dialect
+		line     string
+		lat, lon float64
+		iso      int
+	}{
+		{djiMini2Dialect{}, "F/2.8, SS 141.87, ISO 110, EV -0.7, DZOOM 1.000, GPS (-69.9191, 46.8451, 19), D 31.42m, H 11.80m, H.S 1.00m/s, V.S 0.70m/s", 46.8451, -69.9191, 110},
+		{djiHTMLDialect{}, "[iso: 100] [shutter: 1/240] [fnum: 280] [ev: 0] [latitude: 46.8451] [longitude: -69.9191] [rel_alt: 11.80 abs_alt: 31.42]", 46.8451, -69.9191, 100},
+		{djiLegacyDialect{}, "GPS(-69.9191, 46.8451, 19.0m) BAROMETER:31.4m ISO:110 Shutter:1/141.87 EV:-0.7 Fnum:2.8", 46.8451, -69.9191, 110},
+		{autelEVODialect{}, "LAT:46.8451 LON:-69.9191 ALT:31.42m SPD:1.00m/s HEADING:182.3 ISO:110 SHUTTER:1/240 FNUM:2.8 EV:0", 46.8451, -69.9191, 110},
+		{parrotAnafiDialect{}, "latitude: 46.8451 longitude: -69.9191 altitude: 31.42 speed_vz: 0.70 yaw: 182.3 iso: 110 shutter_speed: 1/240 aperture: 2.8 ev: 0", 46.8451, -69.9191, 110},
+	}
+
+	for _, c := range cases {
+		t.Run(c.dialect.Name(), func(t *testing.T) {
+			if !c.dialect.Matches(c.line) {
+				t.Fatalf("%s: Matches returned false for its own example line", c.dialect.Name())
+			}
+
+			if got := detectDialect(c.line); got == nil || got.Name() != c.dialect.Name() {
+				t.Fatalf("detectDialect picked %v, want %s", got, c.dialect.Name())
+			}
+
+			s, err := c.dialect.Parse(c.line)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if s.Latitude != c.lat || s.Longitude != c.lon {
+				t.Fatalf("got lat/lon %v/%v, want %v/%v", s.Latitude, s.Longitude, c.lat, c.lon)
+			}
+			if s.ISO != c.iso {
+				t.Fatalf("got ISO %v, want %v", s.ISO, c.iso)
+			}
+		})
+	}
+}
+
+// TestDJIHTMLTwoLineBlock guards against the DJI-HTML dialect regressing to
+// requiring "<font" and the bracketed telemetry on the same physical line:
+// real DJI-HTML SRT always splits them across two lines, and earlier this
+// tool silently dropped every sample from such files.
+func TestDJIHTMLTwoLineBlock(t *testing.T) {
+	srt := "\xEF\xBB\xBF1\n" +
+		"00:00:43,000 --> 00:00:44,000\n" +
+		"<font size=\"28\">FrameCnt: 1, DiffTime: 33ms\n" +
+		"[iso: 100] [shutter: 1/240] [fnum: 280] [ev: 0] [latitude: 46.8451] [longitude: -69.9191] [rel_alt: 11.80 abs_alt: 31.42]</font>\n"
+
+	m, errs := parseSRT([]byte(srt))
+	if len(errs) != 0 {
+		t.Fatalf("unexpected parse errors: %v", errs)
+	}
+	if len(m) != 1 {
+		t.Fatalf("got %d samples, want 1", len(m))
+	}
+	if m[0].Latitude != 46.8451 || m[0].Longitude != -69.9191 {
+		t.Fatalf("got lat/lon %v/%v, want 46.8451/-69.9191", m[0].Latitude, m[0].Longitude)
+	}
+}
+
+// TestUnknownDataLineReportsError checks that a line that looks like it
+// should carry telemetry, but doesn't match the locked-in dialect, is
+// reported back as a *SRTParseError rather than silently skipped.
+func TestUnknownDataLineReportsError(t *testing.T) {
+	srt := "\xEF\xBB\xBF1\n" +
+		"00:00:43,000 --> 00:00:44,000\n" +
+		"F/2.8, SS 141.87, ISO 110, EV -0.7, DZOOM 1.000, GPS (-69.9191, 46.8451, 19), D 31.42m, H 11.80m, H.S 1.00m/s, V.S 0.70m/s\n" +
+		"\n" +
+		"2\n" +
+		"00:00:44,000 --> 00:00:45,000\n" +
+		"this is not a DJI-Mini2 data line\n"
+
+	_, errs := parseSRT([]byte(srt))
+	if len(errs) != 1 {
+		t.Fatalf("got %d parse errors, want 1", len(errs))
+	}
+}
+
+// TestNoKnownDialectReportsErrors checks the other half of the "don't
+// silently drop lines" requirement: a file whose very first data line
+// never matches any known dialect (so dialect is never locked in) must
+// still surface a parse error per data line instead of returning 0
+// samples and 0 errors.
+func TestNoKnownDialectReportsErrors(t *testing.T) {
+	srt := "\xEF\xBB\xBF1\n" +
+		"00:00:43,000 --> 00:00:44,000\n" +
+		"this firmware's telemetry line matches no known dialect\n"
+
+	samples, errs := parseSRT([]byte(srt))
+	if len(samples) != 0 {
+		t.Fatalf("got %d samples, want 0", len(samples))
+	}
+	if len(errs) != 1 {
+		t.Fatalf("got %d parse errors, want 1", len(errs))
+	}
+	if errs[0].Dialect != "unknown" {
+		t.Fatalf("got dialect %q, want %q", errs[0].Dialect, "unknown")
+	}
+}
+
+// TestDJIHTMLLeavesDTHUnset guards against abs_alt being mistaken for DTH
+// (distance-to-home): DJI-HTML's bracketed fields only carry rel_alt
+// (height above the home point) and abs_alt (height above sea level),
+// neither of which is a horizontal distance, so DTH has nothing to parse
+// from and must stay zero.
+func TestDJIHTMLLeavesDTHUnset(t *testing.T) {
+	line := "[iso: 100] [shutter: 1/240] [fnum: 280] [ev: 0] [latitude: 46.8451] [longitude: -69.9191] [rel_alt: 11.80 abs_alt: 31.42]"
+
+	s, err := djiHTMLDialect{}.Parse(line)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if s.DTH != 0 {
+		t.Fatalf("got DTH %v, want 0", s.DTH)
+	}
+	if s.Altitude != 11.80 {
+		t.Fatalf("got Altitude %v, want 11.80", s.Altitude)
+	}
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"os"
+)
+
+// gpxExporter writes the metrology as a GPX 1.1 track, one <trkpt> per
+// sample, with speed/bearing/camera settings carried as extensions so the
+// track can still be dropped straight into Google Earth, QGIS or an OSM
+// editor that ignores extensions it doesn't understand.
+type gpxGPX struct {
+	XMLName xml.Name `xml:"gpx"`
+	Version string   `xml:"version,attr"`
+	Creator string   `xml:"creator,attr"`
+	Xmlns   string   `xml:"xmlns,attr"`
+	Trk     gpxTrk   `xml:"trk"`
+}
+
+type gpxTrk struct {
+	Name string    `xml:"name"`
+	Seg  gpxTrkSeg `xml:"trkseg"`
+}
+
+type gpxTrkSeg struct {
+	Points []gpxTrkPt `xml:"trkpt"`
+}
+
+type gpxTrkPt struct {
+	Lat        float64       `xml:"lat,attr"`
+	Lon        float64       `xml:"lon,attr"`
+	Ele        float64       `xml:"ele"`
+	Time       string        `xml:"time"`
+	Extensions gpxExtensions `xml:"extensions"`
+}
+
+type gpxExtensions struct {
+	Speed   float64 `xml:"speed"`
+	Bearing float64 `xml:"course"`
+	ISO     int     `xml:"iso"`
+	Shutter float64 `xml:"shutter"`
+	FStop   float64 `xml:"fstop"`
+}
+
+func gpxExporter(m Metrology) {
+	doc := gpxGPX{
+		Version: "1.1",
+		Creator: "droneMetrologyExporter",
+		Xmlns:   "http://www.topografix.com/GPX/1/1",
+		Trk: gpxTrk{
+			Name: "drone flight",
+		},
+	}
+
+	for _, s := range m {
+		doc.Trk.Seg.Points = append(doc.Trk.Seg.Points, gpxTrkPt{
+			Lat:  s.Latitude,
+			Lon:  s.Longitude,
+			Ele:  s.Altitude,
+			Time: s.Start.UTC().Format("2006-01-02T15:04:05.000Z"),
+			Extensions: gpxExtensions{
+				Speed:   s.HorizontalSpeed,
+				Bearing: s.Bearing,
+				ISO:     s.ISO,
+				Shutter: s.Shutter,
+				FStop:   s.FStop,
+			},
+		})
+	}
+
+	fmt.Print(xml.Header)
+	out, err := xml.MarshalIndent(doc, "", "\t")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println(string(out))
+}
+
+// kmlExporter writes the metrology as a KML LineString with an absolute
+// altitude mode, plus one timestamped Placemark per sample so the flight
+// can be scrubbed frame by frame in Google Earth.
+type kmlKML struct {
+	XMLName xml.Name    `xml:"kml"`
+	Xmlns   string      `xml:"xmlns,attr"`
+	Doc     kmlDocument `xml:"Document"`
+}
+
+type kmlDocument struct {
+	Name string `xml:"name"`
+	// Placemarks holds the track-path Placemark followed by one per-sample
+	// point Placemark; they share a single field because encoding/xml
+	// rejects two struct fields mapped to the same element tag.
+	Placemarks []kmlPlacemark `xml:"Placemark"`
+}
+
+type kmlPlacemark struct {
+	Name       string         `xml:"name,omitempty"`
+	TimeStamp  *kmlTimeStamp  `xml:"TimeStamp,omitempty"`
+	LineString *kmlLineString `xml:"LineString,omitempty"`
+	Point      *kmlPoint      `xml:"Point,omitempty"`
+}
+
+type kmlTimeStamp struct {
+	When string `xml:"when"`
+}
+
+type kmlLineString struct {
+	AltitudeMode string `xml:"altitudeMode"`
+	Coordinates  string `xml:"coordinates"`
+}
+
+type kmlPoint struct {
+	AltitudeMode string `xml:"altitudeMode"`
+	Coordinates  string `xml:"coordinates"`
+}
+
+func kmlExporter(m Metrology) {
+	coords := ""
+	for _, s := range m {
+		coords += fmt.Sprintf("%f,%f,%f\n", s.Longitude, s.Latitude, s.Altitude)
+	}
+
+	doc := kmlKML{
+		Xmlns: "http://www.opengis.net/kml/2.2",
+		Doc: kmlDocument{
+			Name: "drone flight",
+			Placemarks: []kmlPlacemark{{
+				Name: "flight path",
+				LineString: &kmlLineString{
+					AltitudeMode: "absolute",
+					Coordinates:  coords,
+				},
+			}},
+		},
+	}
+
+	for i, s := range m {
+		doc.Doc.Placemarks = append(doc.Doc.Placemarks, kmlPlacemark{
+			Name: fmt.Sprintf("sample %d", i),
+			TimeStamp: &kmlTimeStamp{
+				When: s.Start.UTC().Format("2006-01-02T15:04:05.000Z"),
+			},
+			Point: &kmlPoint{
+				AltitudeMode: "absolute",
+				Coordinates:  fmt.Sprintf("%f,%f,%f", s.Longitude, s.Latitude, s.Altitude),
+			},
+		})
+	}
+
+	fmt.Print(xml.Header)
+	out, err := xml.MarshalIndent(doc, "", "\t")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println(string(out))
+}
+
+// geojsonExporter writes the metrology as a GeoJSON FeatureCollection, one
+// Point feature per sample, with the camera and motion data carried as
+// feature properties for downstream spatial joins.
+type geojsonFeatureCollection struct {
+	Type     string           `json:"type"`
+	Features []geojsonFeature `json:"features"`
+}
+
+type geojsonFeature struct {
+	Type       string                 `json:"type"`
+	Geometry   geojsonGeometry        `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+type geojsonGeometry struct {
+	Type        string    `json:"type"`
+	Coordinates []float64 `json:"coordinates"`
+}
+
+func geojsonExporter(m Metrology) {
+	fc := geojsonFeatureCollection{Type: "FeatureCollection"}
+
+	for _, s := range m {
+		fc.Features = append(fc.Features, geojsonFeature{
+			Type: "Feature",
+			Geometry: geojsonGeometry{
+				Type:        "Point",
+				Coordinates: []float64{s.Longitude, s.Latitude, s.Altitude},
+			},
+			Properties: map[string]interface{}{
+				"id":               s.ID,
+				"time":             s.Start.UTC().Format("2006-01-02T15:04:05.000Z"),
+				"horizontal_speed": s.HorizontalSpeed,
+				"vertical_speed":   s.VerticalSpeed,
+				"bearing":          s.Bearing,
+				"iso":              s.ISO,
+				"shutter":          s.Shutter,
+				"fstop":            s.FStop,
+				"ev":               s.EV,
+				"satellites":       s.Sources,
+				"dth":              s.DTH,
+			},
+		})
+	}
+
+	data, err := json.MarshalIndent(fc, "", "\t")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return
+	}
+	fmt.Println(string(data))
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"math"
+	"os"
+)
+
+// cameraIntrinsics describes the lens/sensor used to project world
+// positions into normalized screen space. Defaults are the DJI Mini2's
+// 4.5mm lens on a 1/2.3" sensor.
+type cameraIntrinsics struct {
+	FocalLengthMM  float64
+	SensorWidthMM  float64
+	SensorHeightMM float64
+}
+
+var mini2Camera = cameraIntrinsics{
+	FocalLengthMM:  4.5,
+	SensorWidthMM:  6.3,
+	SensorHeightMM: 4.72,
+}
+
+// fusionFrame is one per-second sample of everything the Fusion template
+// needs to render: the HUD values plus a projected screen position for the
+// heading indicator.
+type fusionFrame struct {
+	Frame     int
+	Altitude  float64
+	Speed     float64
+	Bearing   float64
+	Latitude  float64
+	Longitude float64
+	HeadingX  float64
+	HeadingY  float64
+	MapX      float64
+	MapY      float64
+}
+
+func multiply(a, b int) int { return a * b }
+
+// projectHeading takes the aircraft's ground velocity (east/north, m/s)
+// and the camera's yaw (the recorded gimbal bearing) and returns where a
+// heading indicator for that velocity vector should sit in normalized
+// screen space (0,0 bottom-left .. 1,1 top-right), using a pinhole
+// projection through cam. This replaces writing raw altitude/bearing
+// numbers straight into a RectangleMask's Width/Height, which had no
+// relationship to anything on screen.
+func projectHeading(cam cameraIntrinsics, eastMPS, northMPS, yawDegrees float64) (x, y float64) {
+	yaw := yawDegrees * math.Pi / 180.0
+
+	// Rotate the world-frame velocity into the camera's (right, forward)
+	// frame so the indicator turns with the gimbal.
+	right := eastMPS*math.Cos(yaw) - northMPS*math.Sin(yaw)
+	forward := eastMPS*math.Sin(yaw) + northMPS*math.Cos(yaw)
+	if forward < 0.1 {
+		forward = 0.1 // keep the indicator in front of the lens
+	}
+
+	xMM := cam.FocalLengthMM * right / forward
+	yMM := cam.FocalLengthMM * 0 / forward // level horizon; no pitch data to project
+
+	x = clamp01(0.5 + xMM/cam.SensorWidthMM)
+	y = clamp01(0.5 + yMM/cam.SensorHeightMM)
+	return x, y
+}
+
+func clamp01(v float64) float64 {
+	if v < 0 {
+		return 0
+	}
+	if v > 1 {
+		return 1
+	}
+	return v
+}
+
+// mapExtent is the bounding box of a flight in map-space, used to project
+// lat/lon onto the inset minimap.
+type mapExtent struct {
+	minLat, maxLat float64
+	minLon, maxLon float64
+}
+
+func (e mapExtent) project(lat, lon float64) (x, y float64) {
+	latSpan := e.maxLat - e.minLat
+	lonSpan := e.maxLon - e.minLon
+	if latSpan == 0 {
+		latSpan = 1
+	}
+	if lonSpan == 0 {
+		lonSpan = 1
+	}
+	return (lon - e.minLon) / lonSpan, (lat - e.minLat) / latSpan
+}
+
+func flightExtent(m Metrology) mapExtent {
+	e := mapExtent{minLat: math.Inf(1), maxLat: math.Inf(-1), minLon: math.Inf(1), maxLon: math.Inf(-1)}
+	for _, s := range m {
+		e.minLat = math.Min(e.minLat, s.Latitude)
+		e.maxLat = math.Max(e.maxLat, s.Latitude)
+		e.minLon = math.Min(e.minLon, s.Longitude)
+		e.maxLon = math.Max(e.maxLon, s.Longitude)
+	}
+	return e
+}
+
+// toEastNorthMPS converts a bearing/ground-speed pair into an east/north
+// velocity vector, the form projectHeading expects.
+func toEastNorthMPS(bearingDegrees, speedMPS float64) (east, north float64) {
+	rad := bearingDegrees * math.Pi / 180.0
+	return speedMPS * math.Sin(rad), speedMPS * math.Cos(rad)
+}
+
+// fusionExporter writes the metrology as a DaVinci Resolve Fusion .setting
+// snippet: a HUD group of TextPlus nodes (altitude, speed, coordinates,
+// heading) driven by per-second BezierSplines and a heading indicator
+// projected through a real camera model, plus a Polyline mask tracing the
+// flight path under an inset minimap Merge. fps sets the keyframe cadence
+// (one keyframe per second of flight, at fps frames per keyframe).
+func fusionExporter(m Metrology, fps int) {
+	extent := flightExtent(m)
+
+	frames := make([]fusionFrame, 0, len(m))
+	for _, s := range m {
+		east, north := toEastNorthMPS(s.Bearing, s.HorizontalSpeed)
+		hx, hy := projectHeading(mini2Camera, east, north, s.Bearing)
+		mx, my := extent.project(s.Latitude, s.Longitude)
+
+		frames = append(frames, fusionFrame{
+			Frame:     s.ID,
+			Altitude:  s.Altitude,
+			Speed:     s.HorizontalSpeed,
+			Bearing:   s.Bearing,
+			Latitude:  s.Latitude,
+			Longitude: s.Longitude,
+			HeadingX:  hx,
+			HeadingY:  hy,
+			MapX:      mx,
+			MapY:      my,
+		})
+	}
+
+	funcMap := template.FuncMap{"multiply": multiply}
+
+	t, err := template.New("fusion").Funcs(funcMap).Parse(fusionTemplate)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	data := struct {
+		Frames []fusionFrame
+		FPS    int
+	}{Frames: frames, FPS: fps}
+
+	if err := t.Execute(os.Stdout, data); err != nil {
+		fmt.Println(err)
+	}
+}
+
+const fusionTemplate = `{
+	Tools = ordered() {
+		AltitudeValue = BezierSpline {
+			NameSet = true,
+			KeyFrames = {
+			{{ range .Frames -}}
+				[{{ multiply .Frame $.FPS }}] = { {{ .Altitude }}, Flags = { Linear = true } },
+			{{ end -}}
+			}
+		},
+		SpeedValue = BezierSpline {
+			NameSet = true,
+			KeyFrames = {
+			{{ range .Frames -}}
+				[{{ multiply .Frame $.FPS }}] = { {{ .Speed }}, Flags = { Linear = true } },
+			{{ end -}}
+			}
+		},
+		HeadingValue = BezierSpline {
+			NameSet = true,
+			KeyFrames = {
+			{{ range .Frames -}}
+				[{{ multiply .Frame $.FPS }}] = { {{ .Bearing }}, Flags = { Linear = true } },
+			{{ end -}}
+			}
+		},
+		HeadingCenterX = BezierSpline {
+			NameSet = true,
+			KeyFrames = {
+			{{ range .Frames -}}
+				[{{ multiply .Frame $.FPS }}] = { {{ .HeadingX }}, Flags = { Linear = true } },
+			{{ end -}}
+			}
+		},
+		HeadingCenterY = BezierSpline {
+			NameSet = true,
+			KeyFrames = {
+			{{ range .Frames -}}
+				[{{ multiply .Frame $.FPS }}] = { {{ .HeadingY }}, Flags = { Linear = true } },
+			{{ end -}}
+			}
+		},
+		LatitudeValue = BezierSpline {
+			NameSet = true,
+			KeyFrames = {
+			{{ range .Frames -}}
+				[{{ multiply .Frame $.FPS }}] = { {{ .Latitude }}, Flags = { Linear = true } },
+			{{ end -}}
+			}
+		},
+		LongitudeValue = BezierSpline {
+			NameSet = true,
+			KeyFrames = {
+			{{ range .Frames -}}
+				[{{ multiply .Frame $.FPS }}] = { {{ .Longitude }}, Flags = { Linear = true } },
+			{{ end -}}
+			}
+		},
+		AltitudeText = TextPlus {
+			Inputs = {
+				GlobalOut = Input { Value = {{ len .Frames }} },
+				StyledText = Input { Expression = "Text(AltitudeValue.Output, Decimals=1) .. \" m\"" },
+				Center = Input { Value = { 0.08, 0.92 } },
+			},
+		},
+		SpeedText = TextPlus {
+			Inputs = {
+				GlobalOut = Input { Value = {{ len .Frames }} },
+				StyledText = Input { Expression = "Text(SpeedValue.Output, Decimals=1) .. \" m/s\"" },
+				Center = Input { Value = { 0.08, 0.88 } },
+			},
+		},
+		CoordsText = TextPlus {
+			Inputs = {
+				GlobalOut = Input { Value = {{ len .Frames }} },
+				StyledText = Input { Expression = "Text(LatitudeValue.Output, Decimals=5) .. \", \" .. Text(LongitudeValue.Output, Decimals=5)" },
+				Center = Input { Value = { 0.08, 0.84 } },
+			},
+		},
+		HeadingText = TextPlus {
+			Inputs = {
+				GlobalOut = Input { Value = {{ len .Frames }} },
+				StyledText = Input { Expression = "Text(HeadingValue.Output, Decimals=0) .. \" deg\"" },
+				Center = {
+					SourceOp = "HeadingCenterPath",
+					Source = "Value",
+				},
+			},
+		},
+		HeadingCenterPath = Transform2D {
+			Inputs = {
+				Center = {
+					Input {
+						SourceOp = "HeadingCenterX",
+						Source = "Value",
+					},
+					Input {
+						SourceOp = "HeadingCenterY",
+						Source = "Value",
+					},
+				},
+			},
+		},
+		FlightPathMask = PolylineMask {
+			CtrlWZoom = false,
+			Inputs = {
+				Polyline = Input {
+					Value = Polyline {
+						Points = {
+						{{ range .Frames -}}
+							{ {{ .MapX }}, {{ .MapY }} },
+						{{ end -}}
+						},
+						Closed = false,
+					},
+				},
+			},
+		},
+		MinimapMerge = Merge {
+			Inputs = {
+				Center = Input { Value = { 0.85, 0.15 } },
+				Size = Input { Value = 0.22 },
+				Background = Input {
+					SourceOp = "FlightPathMask",
+					Source = "Output",
+				},
+			},
+		},
+	}
+}
+`
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+)
+
+// geofenceSchema is the JSON schema describing airspace polygon files;
+// geofenceZone below is its Go counterpart. loadGeofenceZones does not
+// validate files against it.
+const geofenceSchema = `{
+	"$schema": "http://json-schema.org/draft-07/schema#",
+	"title": "Airspace polygons",
+	"type": "array",
+	"items": {
+		"type": "object",
+		"required": ["name", "polygon"],
+		"properties": {
+			"name": { "type": "string" },
+			"polygon": {
+				"type": "array",
+				"minItems": 3,
+				"items": {
+					"type": "object",
+					"required": ["lat", "lon"],
+					"properties": {
+						"lat": { "type": "number" },
+						"lon": { "type": "number" }
+					}
+				}
+			}
+		}
+	}
+}`
+
+// geofenceZone is one named airspace polygon, e.g. a restricted zone to
+// check a flight against.
+type geofenceZone struct {
+	Name    string          `json:"name"`
+	Polygon []geofencePoint `json:"polygon"`
+}
+
+type geofencePoint struct {
+	Lat float64 `json:"lat"`
+	Lon float64 `json:"lon"`
+}
+
+// loadGeofenceZones reads a JSON file of airspace polygons matching
+// geofenceSchema.
+func loadGeofenceZones(path string) ([]geofenceZone, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var zones []geofenceZone
+	if err := json.Unmarshal(raw, &zones); err != nil {
+		return nil, fmt.Errorf("geofence: %s: %w", path, err)
+	}
+
+	return zones, nil
+}
+
+// runGeofenceMode reports the first sample entering each named zone, in
+// flight order. Each zone's bounding box is checked against the flight's
+// R-tree Index first, so only samples that could plausibly be inside the
+// (possibly concave) polygon ever reach the exact pointInPolygon test.
+func runGeofenceMode(m Metrology, zonesFile string) {
+	zones, err := loadGeofenceZones(zonesFile)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	idx := m.Index()
+
+	for _, zone := range zones {
+		polygon := make([]Point, len(zone.Polygon))
+		for i, p := range zone.Polygon {
+			polygon[i] = Point{lat: p.Lat, lng: p.Lon}
+		}
+
+		inZone := make(map[*MetrologySample]bool)
+		for _, s := range idx.Within(polygonBBox(polygon)) {
+			if pointInPolygon(s.Latitude, s.Longitude, polygon) {
+				inZone[s] = true
+			}
+		}
+
+		wasInside := false
+		for _, s := range m {
+			inside := inZone[s]
+			if inside && !wasInside {
+				fmt.Printf("%s: entered at sample %d (%s) at %.6f,%.6f\n", zone.Name, s.ID, s.Start, s.Latitude, s.Longitude)
+				break
+			}
+			wasInside = inside
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+func captureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := os.Stdout
+	os.Stdout = w
+	fn()
+	w.Close()
+	os.Stdout = old
+
+	var buf bytes.Buffer
+	io.Copy(&buf, r)
+	return buf.String()
+}
+
+func TestRunGeofenceModeReportsFirstEntry(t *testing.T) {
+	m := samplesAt([][2]float64{
+		{-1, -1}, // outside the zone
+		{5, 5},   // first sample inside the zone
+		{6, 6},   // still inside; should not be reported
+	})
+
+	zones := []geofenceZone{{
+		Name: "test-zone",
+		Polygon: []geofencePoint{
+			{Lat: 0, Lon: 0}, {Lat: 0, Lon: 10}, {Lat: 10, Lon: 10}, {Lat: 10, Lon: 0},
+		},
+	}}
+
+	enc, err := json.Marshal(zones)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.CreateTemp(t.TempDir(), "zones-*.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write(enc); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	out := captureStdout(t, func() { runGeofenceMode(m, f.Name()) })
+	if !strings.Contains(out, "test-zone: entered at sample 1") {
+		t.Fatalf("unexpected output: %q", out)
+	}
+	if strings.Contains(out, "sample 2") {
+		t.Fatalf("reported a second entry into the same zone: %q", out)
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import "math"
+
+// earthRadiusMeters is used to project latitude/longitude velocities into
+// meters/second via an equirectangular approximation, which is accurate
+// enough over the scale of a single drone flight.
+const earthRadiusMeters = 6371000.0
+
+// kalman1D is a constant-velocity Kalman filter over a single scalar axis:
+// state x = [position, velocity], predicted with F = [[1, dt], [0, 1]] and
+// process noise Q = q * [[dt^3/3, dt^2/2], [dt^2/2, dt]], and updated
+// against a direct position measurement (H = [1, 0]).
+type kalman1D struct {
+	x  [2]float64    // [position, velocity]
+	p  [2][2]float64 // covariance
+	on bool          // has it seen a measurement yet
+}
+
+func (k *kalman1D) predict(dt, q float64) {
+	if !k.on {
+		return
+	}
+
+	f01 := dt
+	pos := k.x[0] + f01*k.x[1]
+	vel := k.x[1]
+
+	// P = F P F^T + Q
+	p00 := k.p[0][0] + f01*(k.p[1][0]+k.p[0][1]) + f01*f01*k.p[1][1]
+	p01 := k.p[0][1] + f01*k.p[1][1]
+	p10 := k.p[1][0] + f01*k.p[1][1]
+	p11 := k.p[1][1]
+
+	q00 := q * dt * dt * dt / 3
+	q01 := q * dt * dt / 2
+	q11 := q * dt
+
+	k.x[0] = pos
+	k.x[1] = vel
+	k.p[0][0] = p00 + q00
+	k.p[0][1] = p01 + q01
+	k.p[1][0] = p10 + q01
+	k.p[1][1] = p11 + q11
+}
+
+func (k *kalman1D) update(z, r float64) {
+	if !k.on {
+		k.x[0] = z
+		k.x[1] = 0
+		k.p = [2][2]float64{{r, 0}, {0, r}}
+		k.on = true
+		return
+	}
+
+	y := z - k.x[0]
+	s := k.p[0][0] + r
+	kGain0 := k.p[0][0] / s
+	kGain1 := k.p[1][0] / s
+
+	k.x[0] += kGain0 * y
+	k.x[1] += kGain1 * y
+
+	p00 := (1 - kGain0) * k.p[0][0]
+	p01 := (1 - kGain0) * k.p[0][1]
+	p10 := k.p[1][0] - kGain1*k.p[0][0]
+	p11 := k.p[1][1] - kGain1*k.p[0][1]
+
+	k.p[0][0] = p00
+	k.p[0][1] = p01
+	k.p[1][0] = p10
+	k.p[1][1] = p11
+}
+
+// smoothMetrology runs a constant-velocity Kalman filter over latitude,
+// longitude and altitude, then re-derives Bearing, HorizontalSpeed and
+// VerticalSpeed from the smoothed velocity instead of the raw frame-to-frame
+// GPS deltas. This gets rid of the "stationary hover produces heading
+// jitter" problem and the "bearing of 0 or 180 means reuse the previous
+// value" hack, since a smoothed velocity of ~0 just yields a low-confidence
+// but stable bearing rather than noise.
+//
+// noiseRatio tunes process noise against measurement noise: larger values
+// trust the raw GPS fixes more (less smoothing), smaller values trust the
+// constant-velocity model more (more smoothing). Measurement noise is also
+// scaled per-sample by the reported satellite count, since fewer satellites
+// means a less trustworthy fix.
+func smoothMetrology(m Metrology, noiseRatio float64) {
+	if len(m) == 0 {
+		return
+	}
+
+	const baseR = 1e-9 // measurement variance (in squared degrees) of a one-satellite fix; divided by the satellite count below
+	q := noiseRatio
+
+	var latF, lonF, altF kalman1D
+
+	for i, s := range m {
+		dt := 1.0
+		if i > 0 {
+			dt = s.Start.Sub(m[i-1].Start).Seconds()
+			if dt <= 0 {
+				dt = 1.0
+			}
+		}
+
+		sats := float64(s.Sources)
+		if sats < 1 {
+			sats = 1
+		}
+		r := baseR / sats
+
+		latF.predict(dt, q)
+		lonF.predict(dt, q)
+		altF.predict(dt, q/10) // altimeter fixes are typically steadier than GPS lat/lon
+
+		latF.update(s.Latitude, r)
+		lonF.update(s.Longitude, r)
+		altF.update(s.Altitude, r*1e6) // altitude is in meters, not degrees; scale R to match
+
+		latRad := latF.x[0] * math.Pi / 180.0
+
+		vNorth := (latF.x[1] * math.Pi / 180.0) * earthRadiusMeters
+		vEast := (lonF.x[1] * math.Pi / 180.0) * earthRadiusMeters * math.Cos(latRad)
+
+		s.Bearing = math.Atan2(vEast, vNorth) * 180.0 / math.Pi
+		if s.Bearing < 0 {
+			s.Bearing += 360
+		}
+		s.HorizontalSpeed = math.Hypot(vNorth, vEast)
+		s.VerticalSpeed = altF.x[1]
+	}
+}
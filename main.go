@@ -1,10 +1,10 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
-	"html/template"
-	"io/ioutil"
+	"io"
 	"math"
 	"os"
 	"regexp"
@@ -15,7 +15,9 @@ import (
 	"github.com/namsral/flag"
 )
 
-// Read a subtitle file (SRT) with DJI Mini2 Drone telemetry and decode it
+// Read a subtitle file (SRT) with drone telemetry and decode it. Several
+// manufacturer/firmware dialects are supported (see dialects.go); the
+// original DJI Mini2 layout looks like:
 //
 // You can grab the SRT out of the MP4 movie with ffmpeg:
 // ffmpeg -txt_format text -i DJI_0023.MP4  DJI_0023.srt
@@ -70,169 +72,6 @@ func BearingTo(p1, p2 *Point) float64 {
 	return brng
 }
 
-// parse SRT file.
-func parseSRT(b []byte) Metrology {
-	metrology := Metrology{}
-
-	s := ""
-	s = string(b[3:])
-	lines := strings.Split(s, "\n")
-
-	r1 := regexp.MustCompile("^([0-9]*)$")
-	r2 := regexp.MustCompile("([0-9:.,]*) --> ([0-9:.,]*)")
-	r3 := regexp.MustCompile("F/([0-9.]*), SS ([0-9.]*), ISO ([0-9.]*), EV ([0-9.-]*), DZOOM ([0-9.]*), GPS \\(([0-9.-]*), ([0-9.-]*), ([0-9.-]*)\\), D ([0-9.-]*)m, H ([0-9.-]*)m, H\\.S ([0-9.-]*)m/s. V\\.S ([0-9.-]*)m/s")
-
-	data := &MetrologySample{}
-	dataLen := 0
-
-	var err error
-
-	for c, l := range lines {
-		if l == "" {
-			data = &MetrologySample{}
-			continue
-		}
-
-		idMatches := r1.FindStringSubmatch(l)
-		if len(idMatches) == 2 {
-			// fmt.Printf("ID: %s\n", idMatches[1])
-			data.ID, _ = strconv.Atoi(idMatches[1])
-
-			continue
-		}
-
-		timeMatches := r2.FindStringSubmatch(l)
-		if len(timeMatches) == 3 {
-			// fmt.Printf("TIME: start: %s | end: %s\n", timeMatches[1], timeMatches[2])
-
-			data.Start, err = parseSrtTime(timeMatches[1])
-			if err != nil {
-				fmt.Printf("srt: start error at line %c: %v", c, err)
-			}
-
-			data.End, err = parseSrtTime(timeMatches[2])
-			if err != nil {
-				fmt.Printf("srt: start error at line %c: %v", c, err)
-			}
-
-			continue
-		}
-
-		dataMatches := r3.FindStringSubmatch(l)
-		if len(dataMatches) >= 3 {
-			// fmt.Printf("DATA:\n\tFStop: %s\n\tShutter Speed: %s\n\tDATA: %s\n", dataMatches[1], dataMatches[2], dataMatches[3])
-			// fmt.Println(dataMatches[1:])
-
-			data.FStop, _ = strconv.ParseFloat(dataMatches[1], 64)
-			data.Shutter, _ = strconv.ParseFloat(dataMatches[2], 64)
-			data.ISO, _ = strconv.Atoi(dataMatches[3])
-			data.EV, _ = strconv.ParseFloat(dataMatches[4], 64)
-			data.Zoom, _ = strconv.Atoi(dataMatches[5])
-			data.Longitude, _ = strconv.ParseFloat(dataMatches[6], 64)
-			data.Latitude, _ = strconv.ParseFloat(dataMatches[7], 64)
-			data.Sources, _ = strconv.Atoi(dataMatches[8])
-			data.DTH, _ = strconv.ParseFloat(dataMatches[9], 64)
-			data.Altitude, _ = strconv.ParseFloat(dataMatches[10], 64)
-			data.HorizontalSpeed, _ = strconv.ParseFloat(dataMatches[11], 64)
-			data.VerticalSpeed, _ = strconv.ParseFloat(dataMatches[11], 64)
-
-			// compute Heading (Bearing)
-			if dataLen > 1 {
-				bearing := BearingTo(
-					&Point{metrology[dataLen-1].Latitude, metrology[dataLen-1].Longitude},
-					&Point{data.Latitude, data.Longitude},
-				)
-				if bearing == 0 || bearing == 180 {
-					data.Bearing = metrology[dataLen-1].Bearing
-				} else {
-					data.Bearing = bearing
-				}
-			}
-			metrology = append(metrology, data)
-			dataLen++
-
-			continue
-		}
-		// fmt.Printf("DATA %d: %s\n", c, l)
-	}
-
-	return metrology
-}
-
-func multiply(a, b int) int { return a * b }
-
-// fusionExporter print the metroloy in a format usable as Resolve Fusion objects
-func fusionExporter(m Metrology) {
-	// 	text = comp:TextPlus()
-	// text.StyledText = "Hello World"
-	// text.Center = comp:Path()
-	// text.Center[0] = {-0.5, 0.5, 0.0}
-	// text.Center[60] = {0.5, 0.5, 0.0}
-	// text.Center[120] = {0, 0.5, 0.0}
-	// text.Center[180] = {0.5, 0.5, 0.0}
-	funcMap := template.FuncMap{"multiply": multiply}
-
-	settingsTemplate := `{
-	Tools = ordered() {
-		Drone = RectangleMask {
-			CtrlWZoom = false,
-			Inputs = {
-				Filter = Input { Value = FuID { "Fast Gaussian" }, },
-				MaskWidth = Input { Value = 2016, },
-				MaskHeight = Input { Value = 1222, },
-				PixelAspect = Input { Value = { 1, 1 }, },
-				UseFrameFormatSettings = Input { Value = 1, },
-				ClippingMode = Input { Value = FuID { "None" }, },
-				Width = Input {
-					SourceOp = "DroneWidth",
-					Source = "Value",
-				},
-				Height = Input {
-					SourceOp = "DroneHeight",
-					Source = "Value",
-				},
-			},
-			ViewInfo = OperatorInfo { Pos = { 434, 86.1515 } },
-		},
-		DroneWidth = BezierSpline {
-			SplineColor = { Red = 225, Green = 255, Blue = 0 },
-			NameSet = true,
-			KeyFrames = { 
-			{{ range . -}}
-				[{{ multiply .ID 30 }}] = { {{.Altitude}}, LH = { 20, 0.666666666666667 }, RH = { 40, 0.666666666666667 }, Flags = { Linear = true } },
-			{{ end }}
-			}
-		},
-		DroneHeight = BezierSpline {
-			SplineColor = { Red = 0, Green = 255, Blue = 255 },
-			NameSet = true,
-			KeyFrames = {
-			{{ range . -}}
-				[{{ multiply .ID 30 }}] = { {{ .Bearing }}, LH = { 20, 0.666666666666667 }, RH = { 40, 0.666666666666667 }, Flags = { Linear = true } },
-				{{ end }}
-			}
-		}
-	}
-}
-`
-
-	t, err := template.New("settings").Funcs(funcMap).Parse(settingsTemplate)
-	if err != nil {
-		fmt.Println(err)
-		return
-	}
-	err = t.Execute(os.Stdout, m)
-	if err != nil {
-		fmt.Println(err)
-		return
-	}
-	// fmt.Printf("drone = comp:RectangleMask()")
-	// for _, s := range m {
-	// 	fmt.Printf("drone.Width[%d] = %f;\n", s.ID, s.Altitude)
-	// 	fmt.Printf("drone.Height[%d] = %d;\n", s.ID, s.Direction)
-	// }
-}
-
 func jsonExporter(m Metrology) {
 	data, _ := json.MarshalIndent(m, "", "\t")
 	fmt.Println(string(data))
@@ -240,28 +79,119 @@ func jsonExporter(m Metrology) {
 
 var (
 	// version is filled by -ldflags  at compile time
-	version = "no version set"
-	srtFile = flag.String("srtfile", "sample.srt", "The SRT file containing the metrology")
-	format  = flag.String("format", "json", "output format, json or fusion")
+	version  = "no version set"
+	srtFile  = flag.String("srtfile", "", "The SRT file containing the metrology, or - to read a live telemetry stream from stdin (e.g. an ffmpeg subtitle pipe)")
+	mp4File  = flag.String("mp4file", "", "An MP4 file to pull the embedded subtitle telemetry track out of, instead of -srtfile")
+	format   = flag.String("format", "json", "output format: json, jsonstream, fusion, gpx, kml or geojson. jsonstream writes one JSON object per sample as soon as it's parsed, rather than waiting to export the whole flight")
+	serve    = flag.Bool("serve", false, "serve the parsed flight as Prometheus metrics on /metrics instead of exporting")
+	listen   = flag.String("listen", ":9469", "address to listen on when -serve is set")
+	smooth   = flag.Float64("smooth", 0, "run a Kalman smoothing pass over bearing/speed/climb rate, tuned by this process/measurement noise ratio (0 disables smoothing)")
+	geofence = flag.String("geofence", "", "path to a JSON file of named airspace polygons; reports the first sample entering each zone instead of exporting")
+	fps      = flag.Int("fps", 30, "frames per second to use for the fusion export's keyframe cadence")
 )
 
 func main() {
 	flag.Parse()
 
-	data, err := ioutil.ReadFile(*srtFile)
+	r, live, err := openTelemetrySource(*mp4File, *srtFile)
 	if err != nil {
 		fmt.Println(err)
+		return
+	}
+	if c, ok := r.(io.Closer); ok {
+		defer c.Close()
+	}
+
+	// jsonstream and -serve on a live stdin pipe are the two consumers that
+	// can start writing before the rest of the flight has even arrived;
+	// everything else (smoothing, geofencing, the GPX/KML/fusion exporters,
+	// a replayed -serve) needs the whole flight in memory and falls through
+	// to collectMetrology below, even when reading from stdin.
+	switch {
+	case *format == "jsonstream":
+		runStreaming(r, jsonStreamExporter)
+		return
+	case *serve && live:
+		samples, errs := parseSRTReader(r)
+		go logParseErrors(errs)
+		serveMetricsLive(samples, *listen)
+		return
+	}
+
+	metrologyData, parseErrors := collectMetrology(r)
+	for _, pe := range parseErrors {
+		fmt.Println(pe)
 	}
 
-	metrologyData := parseSRT(data)
+	if *smooth > 0 {
+		smoothMetrology(metrologyData, *smooth)
+	}
 
-	if *format == "json" {
+	if *serve {
+		serveMetrics(metrologyData, *listen)
+		return
+	}
+
+	if *geofence != "" {
+		runGeofenceMode(metrologyData, *geofence)
+		return
+	}
+
+	switch *format {
+	case "json":
 		jsonExporter(metrologyData)
-	} else {
-		fusionExporter(metrologyData)
+	case "gpx":
+		gpxExporter(metrologyData)
+	case "kml":
+		kmlExporter(metrologyData)
+	case "geojson":
+		geojsonExporter(metrologyData)
+	default:
+		fusionExporter(metrologyData, *fps)
 	}
 }
 
+// openTelemetrySource resolves -mp4file/-srtfile into the io.Reader the rest
+// of main reads telemetry from, and reports whether it's a live stream (a
+// stdin pipe, as opposed to a file whose whole length is known up front)
+// the caller can feed straight to a streaming consumer instead of buffering.
+func openTelemetrySource(mp4File, srtFile string) (io.Reader, bool, error) {
+	switch {
+	case mp4File != "":
+		data, err := extractSRTFromMP4(mp4File)
+		if err != nil {
+			return nil, false, err
+		}
+		return bytes.NewReader(data), false, nil
+	case srtFile == "-":
+		return os.Stdin, true, nil
+	case srtFile != "":
+		f, err := os.Open(srtFile)
+		return f, false, err
+	default:
+		f, err := os.Open("sample.srt")
+		return f, false, err
+	}
+}
+
+// logParseErrors drains a *SRTParseError channel to stdout; it's run in its
+// own goroutine so a slow or unbounded error stream can never block the
+// sample channel it's paired with.
+func logParseErrors(errs <-chan *SRTParseError) {
+	for pe := range errs {
+		fmt.Println(pe)
+	}
+}
+
+// runStreaming decodes r and hands each sample to export as soon as it's
+// parsed, draining parse errors concurrently so neither side blocks the
+// other.
+func runStreaming(r io.Reader, export func(<-chan *MetrologySample)) {
+	samples, errs := parseSRTReader(r)
+	go logParseErrors(errs)
+	export(samples)
+}
+
 // parseSrtTime parses a srt subtitle time (duration since start of film).
 func parseSrtTime(in string) (time.Time, error) {
 	// . and , to :
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// metricsReplay drives a replay clock over a parsed flight: it advances
+// through the samples in step with their original SRT timestamps so a
+// scrape of /metrics always reflects "where the drone is" at the current
+// wall-clock offset into the flight, letting a Grafana dashboard be built
+// against a recorded flight as if it were live telemetry.
+type metricsReplay struct {
+	mu      sync.RWMutex
+	samples Metrology
+	current *MetrologySample
+}
+
+func newMetricsReplay(m Metrology) *metricsReplay {
+	r := &metricsReplay{samples: m}
+	if len(m) > 0 {
+		r.current = m[0]
+	}
+	return r
+}
+
+// run advances the replay clock in the background, sleeping for the gap
+// between consecutive samples' Start times so a full flight replays in
+// roughly the time it took to fly.
+func (r *metricsReplay) run() {
+	for i, s := range r.samples {
+		r.mu.Lock()
+		r.current = s
+		r.mu.Unlock()
+
+		if i+1 >= len(r.samples) {
+			break
+		}
+
+		wait := r.samples[i+1].Start.Sub(s.Start)
+		if wait > 0 {
+			time.Sleep(wait)
+		}
+	}
+}
+
+func (r *metricsReplay) sample() *MetrologySample {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.current
+}
+
+// feed drives the replay from a live sample channel instead of a recorded
+// Metrology slice: it doesn't pace against the samples' Start timestamps,
+// each sample simply becomes current as soon as it arrives off the wire.
+func (r *metricsReplay) feed(samples <-chan *MetrologySample) {
+	for s := range samples {
+		r.mu.Lock()
+		r.current = s
+		r.mu.Unlock()
+	}
+}
+
+// writeMetrics renders the current sample in Prometheus text exposition
+// format.
+func (r *metricsReplay) writeMetrics(w http.ResponseWriter) {
+	s := r.sample()
+	if s == nil {
+		return
+	}
+
+	metrics := []struct {
+		name  string
+		help  string
+		value float64
+	}{
+		{"drone_altitude_meters", "Altitude above the home point, in meters", s.Altitude},
+		{"drone_horizontal_speed_mps", "Horizontal ground speed, in meters/second", s.HorizontalSpeed},
+		{"drone_vertical_speed_mps", "Vertical climb rate, in meters/second", s.VerticalSpeed},
+		{"drone_bearing_degrees", "Heading, in degrees from north", s.Bearing},
+		{"drone_iso", "Camera ISO setting", float64(s.ISO)},
+		{"drone_shutter", "Camera shutter speed denominator", s.Shutter},
+		{"drone_fstop", "Camera aperture f-stop", s.FStop},
+		{"drone_ev", "Camera exposure value", s.EV},
+		{"drone_satellites", "Number of connected GPS satellites", float64(s.Sources)},
+		{"drone_dth_meters", "Distance to home point, in meters", s.DTH},
+		{"drone_latitude", "Latitude of the current position", s.Latitude},
+		{"drone_longitude", "Longitude of the current position", s.Longitude},
+	}
+
+	for _, m := range metrics {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s %v\n", m.name, m.help, m.name, m.name, m.value)
+	}
+}
+
+// serveMetrics starts the replay clock and serves /metrics over HTTP until
+// the process is killed.
+func serveMetrics(m Metrology, addr string) {
+	if len(m) == 0 {
+		fmt.Println("serve: no samples to replay")
+		return
+	}
+
+	replay := newMetricsReplay(m)
+	go replay.run()
+
+	http.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		replay.writeMetrics(w)
+	})
+
+	fmt.Printf("serving /metrics on %s (replaying %d samples)\n", addr, len(m))
+	log.Fatal(http.ListenAndServe(addr, nil))
+}
+
+// serveMetricsLive serves /metrics off a live sample channel (e.g. a running
+// ffmpeg subtitle pipe) instead of a pre-parsed flight, so a scrape always
+// reflects the drone's true current telemetry rather than a replay.
+func serveMetricsLive(samples <-chan *MetrologySample, addr string) {
+	replay := &metricsReplay{}
+	go replay.feed(samples)
+
+	http.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		replay.writeMetrics(w)
+	})
+
+	fmt.Printf("serving /metrics on %s (live stream)\n", addr)
+	log.Fatal(http.ListenAndServe(addr, nil))
+}
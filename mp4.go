@@ -0,0 +1,356 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"time"
+)
+
+// mp4Box is one atom of an ISO base media file: a 4-byte size, a 4-byte
+// type and its payload. Sizes of 0 mean "extends to EOF", a size of 1 means
+// the real size is a following 64bit "largesize" field; both are handled
+// below since drone MP4s commonly use 64bit sizes for the mdat atom.
+type mp4Box struct {
+	typ     string
+	payload []byte
+}
+
+// walkBoxes splits a run of bytes into its top-level boxes.
+func walkBoxes(b []byte) []mp4Box {
+	var boxes []mp4Box
+
+	for len(b) >= 8 {
+		size := uint64(binary.BigEndian.Uint32(b[0:4]))
+		typ := string(b[4:8])
+		header := 8
+
+		if size == 1 {
+			if len(b) < 16 {
+				break
+			}
+			size = binary.BigEndian.Uint64(b[8:16])
+			header = 16
+		} else if size == 0 {
+			size = uint64(len(b))
+		}
+
+		if size < uint64(header) || size > uint64(len(b)) {
+			break
+		}
+
+		boxes = append(boxes, mp4Box{typ: typ, payload: b[header:size]})
+		b = b[size:]
+	}
+
+	return boxes
+}
+
+// findBox returns the first direct child box of the given type.
+func findBox(boxes []mp4Box, typ string) *mp4Box {
+	for i := range boxes {
+		if boxes[i].typ == typ {
+			return &boxes[i]
+		}
+	}
+	return nil
+}
+
+// tx3gSampleTable holds everything needed to locate and read the samples of
+// a subtitle track: per-sample byte offsets, sizes and durations.
+type tx3gSampleTable struct {
+	timescale uint32
+	durations []uint32 // one entry per sample, in timescale units
+	sizes     []uint32
+	offsets   []uint64
+}
+
+// extractSRTFromMP4 walks an MP4's moov/trak atoms, finds the first track
+// whose sample description is a tx3g (subtitle) track, and reassembles its
+// samples into an SRT-formatted byte buffer so it can be fed straight into
+// parseSRT. This removes the need to shell out to ffmpeg just to pull the
+// telemetry track out of the video container.
+func extractSRTFromMP4(path string) ([]byte, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	top := walkBoxes(raw)
+	moov := findBox(top, "moov")
+	if moov == nil {
+		return nil, fmt.Errorf("mp4: no moov atom found in %s", path)
+	}
+
+	for _, trak := range walkBoxes(moov.payload) {
+		if trak.typ != "trak" {
+			continue
+		}
+
+		table, ok := tx3gTableFromTrak(trak.payload)
+		if !ok {
+			continue
+		}
+
+		return assembleSRT(raw, table)
+	}
+
+	return nil, fmt.Errorf("mp4: no tx3g subtitle track found in %s", path)
+}
+
+// tx3gTableFromTrak extracts the sample table from a trak box, and reports
+// ok=false if this trak isn't a tx3g subtitle track.
+func tx3gTableFromTrak(trak []byte) (tx3gSampleTable, bool) {
+	var table tx3gSampleTable
+
+	mdia := findBox(walkBoxes(trak), "mdia")
+	if mdia == nil {
+		return table, false
+	}
+
+	mdiaBoxes := walkBoxes(mdia.payload)
+
+	mdhd := findBox(mdiaBoxes, "mdhd")
+	if mdhd == nil || len(mdhd.payload) < 20 {
+		return table, false
+	}
+	if mdhd.payload[0] == 1 {
+		// version 1: 64bit creation/modification time
+		table.timescale = binary.BigEndian.Uint32(mdhd.payload[20:24])
+	} else {
+		table.timescale = binary.BigEndian.Uint32(mdhd.payload[12:16])
+	}
+
+	minf := findBox(mdiaBoxes, "minf")
+	if minf == nil {
+		return table, false
+	}
+
+	stbl := findBox(walkBoxes(minf.payload), "stbl")
+	if stbl == nil {
+		return table, false
+	}
+
+	stblBoxes := walkBoxes(stbl.payload)
+
+	stsd := findBox(stblBoxes, "stsd")
+	if stsd == nil || len(stsd.payload) < 8 || !bytes.Contains(stsd.payload[8:], []byte("tx3g")) {
+		return table, false
+	}
+
+	stts := findBox(stblBoxes, "stts")
+	stsz := findBox(stblBoxes, "stsz")
+	stsc := findBox(stblBoxes, "stsc")
+	co64 := findBox(stblBoxes, "co64")
+	stco := findBox(stblBoxes, "stco")
+
+	if stts == nil || stsz == nil || stsc == nil || (co64 == nil && stco == nil) {
+		return table, false
+	}
+
+	table.durations = parseSTTS(stts.payload)
+	table.sizes = parseSTSZ(stsz.payload)
+
+	var chunkOffsets []uint64
+	if co64 != nil {
+		chunkOffsets = parseCO64(co64.payload)
+	} else {
+		chunkOffsets = parseSTCO(stco.payload)
+	}
+
+	// STCO/CO64 give one offset per *chunk*, not per sample: a chunk can
+	// hold several samples back to back, and STSC says how many. Expand
+	// those into one offset per sample before handing the table off.
+	table.offsets = sampleOffsets(chunkOffsets, parseSTSC(stsc.payload), table.sizes)
+
+	return table, true
+}
+
+func parseSTTS(p []byte) []uint32 {
+	if len(p) < 8 {
+		return nil
+	}
+	count := binary.BigEndian.Uint32(p[4:8])
+	var durations []uint32
+	off := 8
+	for i := uint32(0); i < count && off+8 <= len(p); i++ {
+		sampleCount := binary.BigEndian.Uint32(p[off : off+4])
+		sampleDelta := binary.BigEndian.Uint32(p[off+4 : off+8])
+		for j := uint32(0); j < sampleCount; j++ {
+			durations = append(durations, sampleDelta)
+		}
+		off += 8
+	}
+	return durations
+}
+
+func parseSTSZ(p []byte) []uint32 {
+	if len(p) < 12 {
+		return nil
+	}
+	uniformSize := binary.BigEndian.Uint32(p[4:8])
+	count := binary.BigEndian.Uint32(p[8:12])
+
+	sizes := make([]uint32, count)
+	if uniformSize != 0 {
+		for i := range sizes {
+			sizes[i] = uniformSize
+		}
+		return sizes
+	}
+
+	off := 12
+	for i := uint32(0); i < count && off+4 <= len(p); i++ {
+		sizes[i] = binary.BigEndian.Uint32(p[off : off+4])
+		off += 4
+	}
+	return sizes
+}
+
+func parseSTCO(p []byte) []uint64 {
+	if len(p) < 8 {
+		return nil
+	}
+	count := binary.BigEndian.Uint32(p[4:8])
+	offsets := make([]uint64, count)
+	off := 8
+	for i := uint32(0); i < count && off+4 <= len(p); i++ {
+		offsets[i] = uint64(binary.BigEndian.Uint32(p[off : off+4]))
+		off += 4
+	}
+	return offsets
+}
+
+// stscEntry is one run of the sample-to-chunk table: starting at firstChunk
+// (1-based) and continuing until the next entry's firstChunk, every chunk
+// holds samplesPerChunk samples.
+type stscEntry struct {
+	firstChunk      uint32
+	samplesPerChunk uint32
+}
+
+func parseSTSC(p []byte) []stscEntry {
+	if len(p) < 8 {
+		return nil
+	}
+	count := binary.BigEndian.Uint32(p[4:8])
+	entries := make([]stscEntry, 0, count)
+	off := 8
+	for i := uint32(0); i < count && off+12 <= len(p); i++ {
+		entries = append(entries, stscEntry{
+			firstChunk:      binary.BigEndian.Uint32(p[off : off+4]),
+			samplesPerChunk: binary.BigEndian.Uint32(p[off+4 : off+8]),
+		})
+		off += 12
+	}
+	return entries
+}
+
+// samplesPerChunk reports how many samples the given (1-based) chunk holds,
+// per the last stsc entry whose firstChunk is at or before it.
+func samplesPerChunk(stsc []stscEntry, chunk uint32) uint32 {
+	var samples uint32
+	for _, e := range stsc {
+		if e.firstChunk > chunk {
+			break
+		}
+		samples = e.samplesPerChunk
+	}
+	return samples
+}
+
+// sampleOffsets walks the chunks in order, using stsc to know how many
+// samples each chunk holds, and accumulates sizes within a chunk to turn
+// the one-offset-per-chunk table STCO/CO64 provide into one offset per
+// sample.
+func sampleOffsets(chunkOffsets []uint64, stsc []stscEntry, sizes []uint32) []uint64 {
+	offsets := make([]uint64, 0, len(sizes))
+
+	sample := 0
+	for i, chunkOffset := range chunkOffsets {
+		n := samplesPerChunk(stsc, uint32(i+1))
+
+		offset := chunkOffset
+		for j := uint32(0); j < n && sample < len(sizes); j++ {
+			offsets = append(offsets, offset)
+			offset += uint64(sizes[sample])
+			sample++
+		}
+	}
+
+	return offsets
+}
+
+func parseCO64(p []byte) []uint64 {
+	if len(p) < 8 {
+		return nil
+	}
+	count := binary.BigEndian.Uint32(p[4:8])
+	offsets := make([]uint64, count)
+	off := 8
+	for i := uint32(0); i < count && off+8 <= len(p); i++ {
+		offsets[i] = binary.BigEndian.Uint64(p[off : off+8])
+		off += 8
+	}
+	return offsets
+}
+
+// assembleSRT reads the sample bytes described by table out of the raw MP4
+// and re-formats them as an SRT-style subtitle buffer (index, time range,
+// text) so they can be handed to parseSRT unchanged.
+func assembleSRT(raw []byte, table tx3gSampleTable) ([]byte, error) {
+	if table.timescale == 0 {
+		return nil, fmt.Errorf("mp4: subtitle track has a zero timescale")
+	}
+
+	var buf bytes.Buffer
+	var elapsed uint64
+
+	for i, off := range table.offsets {
+		if i >= len(table.sizes) || i >= len(table.durations) {
+			break
+		}
+
+		size := table.sizes[i]
+		if off+uint64(size) > uint64(len(raw)) || size < 2 {
+			elapsed += uint64(table.durations[i])
+			continue
+		}
+
+		sample := raw[off : off+uint64(size)]
+		// tx3g samples are prefixed with a 2 byte big-endian text length.
+		textLen := binary.BigEndian.Uint16(sample[0:2])
+		text := ""
+		if int(textLen) <= len(sample)-2 {
+			text = string(sample[2 : 2+textLen])
+		}
+
+		start := makeTime(0, 0, 0, 0).Add(durationFromTimescale(elapsed, table.timescale))
+		end := makeTime(0, 0, 0, 0).Add(durationFromTimescale(elapsed+uint64(table.durations[i]), table.timescale))
+
+		fmt.Fprintf(&buf, "%d\n%s --> %s\n%s\n\n", i+1, formatSrtTime(start), formatSrtTime(end), text)
+
+		elapsed += uint64(table.durations[i])
+	}
+
+	if buf.Len() == 0 {
+		return nil, fmt.Errorf("mp4: subtitle track produced no samples")
+	}
+
+	// parseSRT strips a leading UTF-8 BOM when one is present, as found in
+	// DJI's own SRT exports; prepend one so the reassembled buffer looks the
+	// same as a file off disk would.
+	return append([]byte{0xEF, 0xBB, 0xBF}, buf.Bytes()...), nil
+}
+
+// durationFromTimescale converts a tick count in the given MP4 timescale
+// into a time.Duration.
+func durationFromTimescale(ticks uint64, timescale uint32) time.Duration {
+	return time.Duration(ticks) * time.Second / time.Duration(timescale)
+}
+
+// formatSrtTime renders a time.Time as an SRT timecode (HH:MM:SS,mmm).
+func formatSrtTime(t time.Time) string {
+	return fmt.Sprintf("%02d:%02d:%02d,%03d", t.Hour(), t.Minute(), t.Second(), t.Nanosecond()/1e6)
+}
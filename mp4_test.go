@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// box wraps payload in a minimal ISO base media box: a 4-byte size, the
+// 4-byte type and the payload itself.
+func box(typ string, payload []byte) []byte {
+	b := make([]byte, 8+len(payload))
+	binary.BigEndian.PutUint32(b[0:4], uint32(len(b)))
+	copy(b[4:8], typ)
+	copy(b[8:], payload)
+	return b
+}
+
+func be32(v uint32) []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, v)
+	return b
+}
+
+// tx3gSample is a raw tx3g subtitle sample: a 2-byte big-endian text length
+// followed by the text itself.
+func tx3gSample(text string) []byte {
+	s := make([]byte, 2+len(text))
+	binary.BigEndian.PutUint16(s[0:2], uint16(len(text)))
+	copy(s[2:], text)
+	return s
+}
+
+// buildTx3gMP4 assembles a minimal MP4 with a single tx3g subtitle track
+// whose 3 samples are split two-per-chunk/one-per-chunk across 2 chunks, so
+// a reader that assumes one STCO offset per sample (rather than per chunk)
+// misreads the second and third samples.
+func buildTx3gMP4(t *testing.T) string {
+	t.Helper()
+
+	samples := [][]byte{tx3gSample("ONE"), tx3gSample("TWOTWO"), tx3gSample("THREE")}
+
+	mdhd := make([]byte, 24)
+	binary.BigEndian.PutUint32(mdhd[12:16], 1000) // timescale
+
+	stsd := append(append([]byte{}, make([]byte, 8)...), []byte("tx3g")...)
+
+	stts := append([]byte{}, make([]byte, 4)...)
+	stts = append(stts, be32(1)...)    // 1 entry
+	stts = append(stts, be32(3)...)    // sample count
+	stts = append(stts, be32(1000)...) // sample delta: 1s at this timescale
+
+	stsz := append([]byte{}, make([]byte, 4)...)
+	stsz = append(stsz, be32(0)...) // not a uniform size
+	stsz = append(stsz, be32(uint32(len(samples)))...)
+	for _, s := range samples {
+		stsz = append(stsz, be32(uint32(len(s)))...)
+	}
+
+	stsc := append([]byte{}, make([]byte, 4)...)
+	stsc = append(stsc, be32(2)...) // 2 entries
+	stsc = append(stsc, be32(1)...)
+	stsc = append(stsc, be32(2)...) // chunk 1: 2 samples/chunk
+	stsc = append(stsc, be32(1)...) // sample description index
+	stsc = append(stsc, be32(2)...)
+	stsc = append(stsc, be32(1)...) // chunk 2: 1 sample/chunk
+	stsc = append(stsc, be32(1)...)
+
+	stbl := box("stsd", stsd)
+	stbl = append(stbl, box("stts", stts)...)
+	stbl = append(stbl, box("stsz", stsz)...)
+	stbl = append(stbl, box("stsc", stsc)...)
+
+	// Chunk offsets are absolute file offsets, so they depend on the size
+	// of everything ahead of the sample data (moov + the mdat header). We
+	// build moov twice: once to measure its size, once for real once the
+	// offsets are known.
+	buildMoov := func(stco []byte) []byte {
+		stblFull := append(append([]byte{}, stbl...), box("stco", stco)...)
+		minf := box("minf", box("stbl", stblFull))
+		mdiaContent := box("mdhd", mdhd)
+		mdiaContent = append(mdiaContent, minf...)
+		trak := box("trak", box("mdia", mdiaContent))
+		return box("moov", trak)
+	}
+
+	// Measure sizes with zeroed offsets first.
+	dummyStco := append([]byte{}, make([]byte, 4)...)
+	dummyStco = append(dummyStco, be32(2)...)
+	dummyStco = append(dummyStco, be32(0)...)
+	dummyStco = append(dummyStco, be32(0)...)
+	moov := buildMoov(dummyStco)
+
+	mdatHeaderLen := 8
+	chunk1Offset := uint32(len(moov) + mdatHeaderLen)
+	chunk2Offset := chunk1Offset + uint32(len(samples[0])+len(samples[1]))
+
+	stco := append([]byte{}, make([]byte, 4)...)
+	stco = append(stco, be32(2)...)
+	stco = append(stco, be32(chunk1Offset)...)
+	stco = append(stco, be32(chunk2Offset)...)
+
+	moov = buildMoov(stco)
+
+	var sampleData []byte
+	for _, s := range samples {
+		sampleData = append(sampleData, s...)
+	}
+	mdat := box("mdat", sampleData)
+
+	raw := append(append([]byte{}, moov...), mdat...)
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "clip.mp4")
+	if err := os.WriteFile(path, raw, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestExtractSRTFromMP4MultiSamplePerChunk(t *testing.T) {
+	path := buildTx3gMP4(t)
+
+	srt, err := extractSRTFromMP4(path)
+	if err != nil {
+		t.Fatalf("extractSRTFromMP4: %v", err)
+	}
+
+	out := string(srt)
+	wantOrder := []string{"ONE", "TWOTWO", "THREE"}
+	last := 0
+	for _, want := range wantOrder {
+		idx := strings.Index(out[last:], want)
+		if idx < 0 {
+			t.Fatalf("missing sample text %q in output:\n%s", want, out)
+		}
+		last += idx + len(want)
+	}
+}
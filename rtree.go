@@ -0,0 +1,245 @@
+package main
+
+import (
+	"math"
+	"sort"
+)
+
+// rtreeLeafSize caps how many samples are grouped under one leaf node's
+// bounding box during bulk loading.
+const rtreeLeafSize = 16
+
+// BBox is an axis-aligned bounding box in lat/lon space.
+type BBox struct {
+	MinLat, MinLon float64
+	MaxLat, MaxLon float64
+}
+
+func (b BBox) contains(lat, lon float64) bool {
+	return lat >= b.MinLat && lat <= b.MaxLat && lon >= b.MinLon && lon <= b.MaxLon
+}
+
+func (b BBox) intersects(o BBox) bool {
+	return b.MinLat <= o.MaxLat && b.MaxLat >= o.MinLat && b.MinLon <= o.MaxLon && b.MaxLon >= o.MinLon
+}
+
+func (b BBox) union(o BBox) BBox {
+	return BBox{
+		MinLat: math.Min(b.MinLat, o.MinLat),
+		MinLon: math.Min(b.MinLon, o.MinLon),
+		MaxLat: math.Max(b.MaxLat, o.MaxLat),
+		MaxLon: math.Max(b.MaxLon, o.MaxLon),
+	}
+}
+
+// minDistSq is the shortest distance (in degrees, squared) from a point to
+// the box; zero if the point is inside it. It's used to prune leaves
+// during nearest-neighbor search.
+func (b BBox) minDistSq(lat, lon float64) float64 {
+	dLat := 0.0
+	if lat < b.MinLat {
+		dLat = b.MinLat - lat
+	} else if lat > b.MaxLat {
+		dLat = lat - b.MaxLat
+	}
+
+	dLon := 0.0
+	if lon < b.MinLon {
+		dLon = b.MinLon - lon
+	} else if lon > b.MaxLon {
+		dLon = lon - b.MaxLon
+	}
+
+	return dLat*dLat + dLon*dLon
+}
+
+// rtreeLeaf groups a handful of samples under one bounding box, the unit
+// bulk-loading groups samples into.
+type rtreeLeaf struct {
+	box     BBox
+	samples []*MetrologySample
+}
+
+// Index is an R-tree over a Metrology's sample positions, built once via
+// bulk loading - sorted on latitude and sliced into fixed-size leaves,
+// a single-axis pack rather than a true sort-tile-recursive (which tiles
+// both axes) - and then queried read-only. It backs geofencing checks,
+// POI joins and "closest frame to this map click" lookups from a
+// downstream viewer.
+type Index struct {
+	box    BBox
+	leaves []rtreeLeaf
+}
+
+// Index builds an R-tree over the flight's sample positions, with each
+// leaf's bounding box drawn tight around its samples (no buffer).
+// indexWithBuffer widens every leaf's bounding box by buffer degrees on
+// each side; queries still test each sample's exact position, so a buffer
+// only loosens leaf pruning and never returns a sample outside the query
+// region.
+func (m Metrology) Index() *Index {
+	return m.indexWithBuffer(0)
+}
+
+func (m Metrology) indexWithBuffer(buffer float64) *Index {
+	if len(m) == 0 {
+		return &Index{}
+	}
+
+	sorted := make(Metrology, len(m))
+	copy(sorted, m)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Latitude < sorted[j].Latitude })
+
+	idx := &Index{}
+
+	for i := 0; i < len(sorted); i += rtreeLeafSize {
+		end := i + rtreeLeafSize
+		if end > len(sorted) {
+			end = len(sorted)
+		}
+
+		group := sorted[i:end]
+		leaf := rtreeLeaf{samples: group}
+		leaf.box = BBox{
+			MinLat: math.Inf(1), MinLon: math.Inf(1),
+			MaxLat: math.Inf(-1), MaxLon: math.Inf(-1),
+		}
+		for _, s := range group {
+			leaf.box.MinLat = math.Min(leaf.box.MinLat, s.Latitude-buffer)
+			leaf.box.MinLon = math.Min(leaf.box.MinLon, s.Longitude-buffer)
+			leaf.box.MaxLat = math.Max(leaf.box.MaxLat, s.Latitude+buffer)
+			leaf.box.MaxLon = math.Max(leaf.box.MaxLon, s.Longitude+buffer)
+		}
+
+		idx.leaves = append(idx.leaves, leaf)
+		idx.box = idx.box.union(leaf.box)
+	}
+
+	return idx
+}
+
+// NearestTo returns the k samples whose position is closest to (lat, lon),
+// nearest first. Leaves are visited in order of minDistSq, the closest
+// point their bounding box could possibly contain, and search stops early
+// once every remaining leaf is farther out than the current k-th best
+// match, so leaves far from (lat, lon) are skipped rather than scanned.
+func (idx *Index) NearestTo(lat, lon float64, k int) []*MetrologySample {
+	if k <= 0 || len(idx.leaves) == 0 {
+		return nil
+	}
+
+	type leafDist struct {
+		leaf   *rtreeLeaf
+		distSq float64
+	}
+
+	order := make([]leafDist, len(idx.leaves))
+	for i := range idx.leaves {
+		order[i] = leafDist{leaf: &idx.leaves[i], distSq: idx.leaves[i].box.minDistSq(lat, lon)}
+	}
+	sort.Slice(order, func(i, j int) bool { return order[i].distSq < order[j].distSq })
+
+	type scored struct {
+		sample *MetrologySample
+		distSq float64
+	}
+
+	var best []scored
+	worstBest := math.Inf(1)
+
+	for _, ld := range order {
+		if len(best) >= k && ld.distSq > worstBest {
+			break
+		}
+
+		for _, s := range ld.leaf.samples {
+			dLat := s.Latitude - lat
+			dLon := s.Longitude - lon
+			best = append(best, scored{sample: s, distSq: dLat*dLat + dLon*dLon})
+		}
+
+		sort.Slice(best, func(i, j int) bool { return best[i].distSq < best[j].distSq })
+		if len(best) > k {
+			best = best[:k]
+		}
+		if len(best) == k {
+			worstBest = best[k-1].distSq
+		}
+	}
+
+	out := make([]*MetrologySample, len(best))
+	for i, b := range best {
+		out[i] = b.sample
+	}
+	return out
+}
+
+// Within returns every sample whose position falls inside bbox.
+func (idx *Index) Within(bbox BBox) []*MetrologySample {
+	var out []*MetrologySample
+	for _, leaf := range idx.leaves {
+		if !leaf.box.intersects(bbox) {
+			continue
+		}
+		for _, s := range leaf.samples {
+			if bbox.contains(s.Latitude, s.Longitude) {
+				out = append(out, s)
+			}
+		}
+	}
+	return out
+}
+
+// SegmentsCrossing returns the later sample of every consecutive pair in m
+// where one endpoint is inside polygon and the other isn't, i.e. every
+// point at which the flight path crosses the polygon's boundary.
+func (m Metrology) SegmentsCrossing(polygon []Point) Metrology {
+	var crossings Metrology
+
+	for i := 1; i < len(m); i++ {
+		before := pointInPolygon(m[i-1].Latitude, m[i-1].Longitude, polygon)
+		after := pointInPolygon(m[i].Latitude, m[i].Longitude, polygon)
+		if before != after {
+			crossings = append(crossings, m[i])
+		}
+	}
+
+	return crossings
+}
+
+// polygonBBox returns the axis-aligned bounding box enclosing polygon's
+// vertices, for narrowing an Index query with Within before the exact
+// (and more expensive) pointInPolygon test.
+func polygonBBox(polygon []Point) BBox {
+	box := BBox{
+		MinLat: math.Inf(1), MinLon: math.Inf(1),
+		MaxLat: math.Inf(-1), MaxLon: math.Inf(-1),
+	}
+	for _, p := range polygon {
+		box.MinLat = math.Min(box.MinLat, p.lat)
+		box.MinLon = math.Min(box.MinLon, p.lng)
+		box.MaxLat = math.Max(box.MaxLat, p.lat)
+		box.MaxLon = math.Max(box.MaxLon, p.lng)
+	}
+	return box
+}
+
+// pointInPolygon reports whether (lat, lon) is inside polygon, using the
+// standard ray-casting algorithm. polygon is treated as lat/lon vertices in
+// order; it does not need to be explicitly closed.
+func pointInPolygon(lat, lon float64, polygon []Point) bool {
+	inside := false
+	n := len(polygon)
+
+	for i, j := 0, n-1; i < n; j, i = i, i+1 {
+		pi, pj := polygon[i], polygon[j]
+		if (pi.lng > lon) != (pj.lng > lon) {
+			latAtLon := (pj.lat-pi.lat)*(lon-pi.lng)/(pj.lng-pi.lng) + pi.lat
+			if lat < latAtLon {
+				inside = !inside
+			}
+		}
+	}
+
+	return inside
+}
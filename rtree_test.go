@@ -0,0 +1,59 @@
+package main
+
+import "testing"
+
+func samplesAt(coords [][2]float64) Metrology {
+	m := make(Metrology, len(coords))
+	for i, c := range coords {
+		m[i] = &MetrologySample{ID: i, Latitude: c[0], Longitude: c[1]}
+	}
+	return m
+}
+
+func TestIndexNearestTo(t *testing.T) {
+	m := samplesAt([][2]float64{
+		{0, 0}, {1, 1}, {5, 5}, {10, 10}, {-5, -5},
+	})
+
+	idx := m.Index()
+	nearest := idx.NearestTo(0.1, 0.1, 2)
+	if len(nearest) != 2 {
+		t.Fatalf("got %d results, want 2", len(nearest))
+	}
+	if nearest[0].Latitude != 0 || nearest[0].Longitude != 0 {
+		t.Fatalf("nearest[0] = %+v, want (0,0)", nearest[0])
+	}
+	if nearest[1].Latitude != 1 || nearest[1].Longitude != 1 {
+		t.Fatalf("nearest[1] = %+v, want (1,1)", nearest[1])
+	}
+}
+
+func TestIndexWithin(t *testing.T) {
+	m := samplesAt([][2]float64{
+		{0, 0}, {1, 1}, {5, 5}, {10, 10},
+	})
+
+	idx := m.Index()
+	got := idx.Within(BBox{MinLat: -1, MaxLat: 2, MinLon: -1, MaxLon: 2})
+	if len(got) != 2 {
+		t.Fatalf("got %d samples within bbox, want 2", len(got))
+	}
+}
+
+func TestSegmentsCrossing(t *testing.T) {
+	square := []Point{{0, 0}, {0, 10}, {10, 10}, {10, 0}}
+	m := samplesAt([][2]float64{
+		{-1, -1}, // outside
+		{5, 5},   // inside: crossing in
+		{5, 5},   // inside: no crossing
+		{20, 20}, // outside: crossing out
+	})
+
+	crossings := m.SegmentsCrossing(square)
+	if len(crossings) != 2 {
+		t.Fatalf("got %d crossings, want 2", len(crossings))
+	}
+	if crossings[0] != m[1] || crossings[1] != m[3] {
+		t.Fatalf("crossings = %+v, want samples 1 and 3", crossings)
+	}
+}
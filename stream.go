@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+)
+
+// parsedSample is either a decoded sample or a line that failed to parse;
+// exactly one of the two fields is set.
+type parsedSample struct {
+	sample *MetrologySample
+	err    *SRTParseError
+}
+
+// scanSamples reads SRT telemetry from r line by line and emits each fully
+// decoded sample (bearing not yet computed) or parse error on the returned
+// channel as soon as it's available, instead of buffering the whole file
+// the way parseSRT historically did with ioutil.ReadFile. This is what lets
+// a long flight's SRT - or a live ffmpeg subtitle pipe - start feeding
+// exporters before the rest of the data has even arrived.
+func scanSamples(r io.Reader) <-chan parsedSample {
+	out := make(chan parsedSample)
+
+	go func() {
+		defer close(out)
+
+		br := bufio.NewReader(r)
+		if bom, err := br.Peek(3); err == nil && bytes.Equal(bom, []byte{0xEF, 0xBB, 0xBF}) {
+			// DJI's own SRT exports start with a UTF-8 BOM; a live ffmpeg
+			// subtitle pipe doesn't, so only strip it when it's there -
+			// unconditionally discarding 3 bytes ate the first index line
+			// of BOM-less input instead.
+			br.Discard(3)
+		}
+
+		r1 := regexp.MustCompile("^([0-9]*)$")
+		r2 := regexp.MustCompile("([0-9:.,]*) --> ([0-9:.,]*)")
+		r3 := regexp.MustCompile(`^<font`)
+
+		var dialect Dialect
+		data := &MetrologySample{}
+		lineNum := 0
+
+		scanner := bufio.NewScanner(br)
+		scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+		for scanner.Scan() {
+			l := scanner.Text()
+			lineNum++
+
+			if l == "" {
+				data = &MetrologySample{}
+				continue
+			}
+
+			idMatches := r1.FindStringSubmatch(l)
+			if len(idMatches) == 2 {
+				data.ID, _ = strconv.Atoi(idMatches[1])
+				continue
+			}
+
+			timeMatches := r2.FindStringSubmatch(l)
+			if len(timeMatches) == 3 {
+				if start, err := parseSrtTime(timeMatches[1]); err == nil {
+					data.Start = start
+				}
+				if end, err := parseSrtTime(timeMatches[2]); err == nil {
+					data.End = end
+				}
+				continue
+			}
+
+			if r3.MatchString(l) {
+				// DJI-HTML wraps "FrameCnt: ..." in its own <font> line
+				// ahead of the bracketed telemetry line; it carries no
+				// data of its own so there's nothing to match or parse.
+				continue
+			}
+
+			if dialect == nil {
+				dialect = detectDialect(l)
+				if dialect == nil {
+					// Blank/id/time/<font> lines are already filtered out
+					// above, so anything reaching here is a data line from
+					// a drone/firmware none of the known dialects
+					// recognize; report it instead of silently dropping
+					// the whole file.
+					out <- parsedSample{err: &SRTParseError{Line: lineNum, Dialect: "unknown", Text: l}}
+					continue
+				}
+			}
+
+			if !dialect.Matches(l) {
+				out <- parsedSample{err: &SRTParseError{Line: lineNum, Dialect: dialect.Name(), Text: l}}
+				continue
+			}
+
+			parsed, err := dialect.Parse(l)
+			if err != nil {
+				if pe, ok := err.(*SRTParseError); ok {
+					pe.Line = lineNum
+					out <- parsedSample{err: pe}
+				}
+				continue
+			}
+
+			data.FStop = parsed.FStop
+			data.Shutter = parsed.Shutter
+			data.ISO = parsed.ISO
+			data.EV = parsed.EV
+			data.Zoom = parsed.Zoom
+			data.Latitude = parsed.Latitude
+			data.Longitude = parsed.Longitude
+			data.Sources = parsed.Sources
+			data.DTH = parsed.DTH
+			data.Altitude = parsed.Altitude
+			data.HorizontalSpeed = parsed.HorizontalSpeed
+			data.VerticalSpeed = parsed.VerticalSpeed
+			data.Bearing = parsed.Bearing
+
+			out <- parsedSample{sample: data}
+		}
+	}()
+
+	return out
+}
+
+// bearingStage is the stateful transform that used to live inline in
+// parseSRT: it remembers the previous sample and fills in Bearing from the
+// GPS delta whenever the dialect didn't already report a heading.
+func bearingStage(in <-chan parsedSample) (<-chan *MetrologySample, <-chan *SRTParseError) {
+	samples := make(chan *MetrologySample)
+	errs := make(chan *SRTParseError)
+
+	go func() {
+		defer close(samples)
+		defer close(errs)
+
+		var prev *MetrologySample
+
+		for item := range in {
+			if item.err != nil {
+				errs <- item.err
+				continue
+			}
+
+			s := item.sample
+			if s.Bearing == 0 && prev != nil {
+				bearing := BearingTo(&Point{prev.Latitude, prev.Longitude}, &Point{s.Latitude, s.Longitude})
+				if bearing == 0 || bearing == 180 {
+					s.Bearing = prev.Bearing
+				} else {
+					s.Bearing = bearing
+				}
+			}
+
+			prev = s
+			samples <- s
+		}
+	}()
+
+	return samples, errs
+}
+
+// parseSRTReader is the streaming entry point: it decodes SRT telemetry
+// from r and yields samples and parse errors on channels as they're read,
+// without ever holding the whole file in memory. parseSRT (the historical
+// []byte-based entry point) is built on top of this.
+func parseSRTReader(r io.Reader) (<-chan *MetrologySample, <-chan *SRTParseError) {
+	return bearingStage(scanSamples(r))
+}
+
+// collectMetrology drains parseSRTReader into a Metrology slice and an
+// error slice, for callers (exporters that need the whole flight at once,
+// such as gpx/kml/fusion) that haven't been converted to streaming
+// consumers.
+func collectMetrology(r io.Reader) (Metrology, []*SRTParseError) {
+	samples, errs := parseSRTReader(r)
+
+	var metrology Metrology
+	var parseErrors []*SRTParseError
+
+	for samples != nil || errs != nil {
+		select {
+		case s, ok := <-samples:
+			if !ok {
+				samples = nil
+				continue
+			}
+			metrology = append(metrology, s)
+		case e, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+			parseErrors = append(parseErrors, e)
+		}
+	}
+
+	return metrology, parseErrors
+}
+
+// parseSRT decodes a subtitle file already read into memory. Kept for
+// callers that have a []byte on hand (e.g. a file read via ioutil.ReadFile
+// or the MP4 subtitle extractor); streaming sources should call
+// parseSRTReader directly instead.
+func parseSRT(b []byte) (Metrology, []*SRTParseError) {
+	return collectMetrology(bytes.NewReader(b))
+}
+
+// jsonStreamExporter writes each sample as its own JSON object, one per
+// line (JSON Lines), as soon as it arrives on the channel - the streaming
+// counterpart to jsonExporter, which needs the whole slice to marshal a
+// single JSON array.
+func jsonStreamExporter(samples <-chan *MetrologySample) {
+	enc := json.NewEncoder(os.Stdout)
+	for s := range samples {
+		if err := enc.Encode(s); err != nil {
+			fmt.Println(err)
+			return
+		}
+	}
+}
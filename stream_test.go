@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+)
+
+const sampleFlightSRT = "\xEF\xBB\xBF1\n" +
+	"00:00:00,000 --> 00:00:01,000\n" +
+	"F/2.8, SS 141.87, ISO 110, EV -0.7, DZOOM 1.000, GPS (-69.9191, 46.8451, 19), D 31.42m, H 11.80m, H.S 1.00m/s, V.S 0.70m/s\n" +
+	"\n" +
+	"2\n" +
+	"00:00:01,000 --> 00:00:02,000\n" +
+	"F/2.8, SS 141.87, ISO 110, EV -0.7, DZOOM 1.000, GPS (-69.9192, 46.8461, 19), D 31.42m, H 11.80m, H.S 1.00m/s, V.S 0.70m/s\n"
+
+// TestParseSRTReaderMatchesParseSRT checks that streaming through an
+// io.Reader produces the same samples as the []byte-based parseSRT it
+// replaced.
+func TestParseSRTReaderMatchesParseSRT(t *testing.T) {
+	want, wantErrs := parseSRT([]byte(sampleFlightSRT))
+	got, gotErrs := collectMetrology(strings.NewReader(sampleFlightSRT))
+
+	if len(gotErrs) != len(wantErrs) {
+		t.Fatalf("got %d parse errors, want %d", len(gotErrs), len(wantErrs))
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d samples, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i].Latitude != want[i].Latitude || got[i].Longitude != want[i].Longitude {
+			t.Fatalf("sample %d: got %+v, want %+v", i, got[i], want[i])
+		}
+		if got[i].Bearing != want[i].Bearing {
+			t.Fatalf("sample %d bearing: got %v, want %v", i, got[i].Bearing, want[i].Bearing)
+		}
+	}
+}
+
+// TestScanSamplesWithoutBOM checks that input with no UTF-8 BOM - e.g. a
+// live "ffmpeg ... -f srt pipe:1" feed, as opposed to a DJI-exported .srt
+// file - parses its first index line correctly instead of having 3 bytes
+// of real data eaten by an unconditional BOM strip.
+func TestScanSamplesWithoutBOM(t *testing.T) {
+	srt := strings.TrimPrefix(sampleFlightSRT, "\xEF\xBB\xBF")
+
+	m, errs := parseSRT([]byte(srt))
+	if len(errs) != 0 {
+		t.Fatalf("unexpected parse errors: %v", errs)
+	}
+	if len(m) != 2 {
+		t.Fatalf("got %d samples, want 2", len(m))
+	}
+	if m[0].ID != 1 {
+		t.Fatalf("got first sample ID %d, want 1", m[0].ID)
+	}
+}
+
+// TestJSONStreamExporter checks that jsonStreamExporter writes one JSON
+// object per sample, as each arrives on the channel, rather than a single
+// JSON array of the whole flight.
+func TestJSONStreamExporter(t *testing.T) {
+	samples, errs := parseSRTReader(strings.NewReader(sampleFlightSRT))
+	go func() {
+		for range errs {
+		}
+	}()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := os.Stdout
+	os.Stdout = w
+	jsonStreamExporter(samples)
+	w.Close()
+	os.Stdout = old
+
+	var buf bytes.Buffer
+	buf.ReadFrom(r)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want 2", len(lines))
+	}
+	for _, l := range lines {
+		var s MetrologySample
+		if err := json.Unmarshal([]byte(l), &s); err != nil {
+			t.Fatalf("line %q did not decode as a single sample: %v", l, err)
+		}
+	}
+}